@@ -0,0 +1,274 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build cgo
+// +build cgo
+
+package webp
+
+/*
+#include <stdlib.h>
+#include "webp/encode.h"
+#include "webp/mux.h"
+#include "webp/demux.h"
+*/
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"time"
+	"unsafe"
+)
+
+// Animation holds the frames and per-frame timing metadata for an animated
+// WebP, analogous to image/gif's GIF struct.
+//
+// Per-frame disposal and blending are not configurable: WebPAnimEncoder, the
+// libwebp API EncodeAll drives, decides both internally (comparing each
+// frame against the canvas to pick whichever produces the smaller frame)
+// and exposes no per-frame input for either. WebPPicture, unlike
+// WebPMuxFrameInfo, has no dispose_method or blend_method field to set them
+// through even if EncodeAll wanted to.
+type Animation struct {
+	// Frames holds the successive images that make up the animation. All
+	// frames must have the same dimensions as the first frame, which sets
+	// the canvas size.
+	Frames []image.Image
+
+	// Delays holds the display duration of each frame. It must have the
+	// same length as Frames.
+	Delays []time.Duration
+
+	// LoopCount is the number of times to loop the animation. 0 means
+	// loop forever.
+	LoopCount int
+
+	// BackgroundColor is the canvas color shown through transparent
+	// regions and, when WebPAnimEncoder decides a frame should dispose to
+	// background, after that frame too.
+	BackgroundColor color.RGBA
+
+	// Options, if non-nil, gives the per-frame encoding options. If it
+	// has fewer entries than Frames, the last entry is reused for the
+	// remaining frames; if nil, each frame is encoded with the package
+	// default Options. Of each entry, only Lossless, Quality, Method and
+	// HighPrecisionInput are applied; the other fields are ignored.
+	Options []*Options
+
+	// ICCP, EXIF and XMP, if non-empty, are embedded as the corresponding
+	// metadata chunks in the assembled animation.
+	ICCP []byte
+	EXIF []byte
+	XMP  []byte
+}
+
+func (a *Animation) optionsForFrame(i int) *Options {
+	if len(a.Options) == 0 {
+		return nil
+	}
+	if i < len(a.Options) {
+		return a.Options[i]
+	}
+	return a.Options[len(a.Options)-1]
+}
+
+// EncodeAll writes a, an animated WebP, to w. It drives libwebp's
+// WebPAnimEncoder (WebPAnimEncoderNew / WebPAnimEncoderAdd /
+// WebPAnimEncoderAssemble) through cgo, the counterpart of Encode for
+// single-image WebP.
+func EncodeAll(w io.Writer, a *Animation) error {
+	if len(a.Frames) == 0 {
+		return errors.New("webp: EncodeAll, no frames")
+	}
+	if len(a.Delays) != len(a.Frames) {
+		return errors.New("webp: EncodeAll, len(Delays) != len(Frames)")
+	}
+
+	b := a.Frames[0].Bounds()
+	width, height := b.Dx(), b.Dy()
+	if width <= 0 || height <= 0 {
+		return errors.New("webp: EncodeAll, empty canvas")
+	}
+
+	encOptions := C.WebPAnimEncoderOptions{}
+	if C.WebPAnimEncoderOptionsInit(&encOptions) == 0 {
+		return errors.New("webp: EncodeAll, WebPAnimEncoderOptionsInit failed")
+	}
+	encOptions.anim_params.loop_count = C.int(a.LoopCount)
+	// WebPMuxAnimParams.bgcolor packs bits 0-7 = Alpha, 8-15 = Red,
+	// 16-23 = Green, 24-31 = Blue.
+	encOptions.anim_params.bgcolor = C.uint32_t(a.BackgroundColor.A) |
+		C.uint32_t(a.BackgroundColor.R)<<8 |
+		C.uint32_t(a.BackgroundColor.G)<<16 |
+		C.uint32_t(a.BackgroundColor.B)<<24
+
+	enc := C.WebPAnimEncoderNew(C.int(width), C.int(height), &encOptions)
+	if enc == nil {
+		return errors.New("webp: EncodeAll, WebPAnimEncoderNew failed")
+	}
+	defer C.WebPAnimEncoderDelete(enc)
+
+	var timestampMs C.int
+	for i, frame := range a.Frames {
+		fb := frame.Bounds()
+		if fb.Dx() != width || fb.Dy() != height {
+			return fmt.Errorf("webp: EncodeAll, frame %d size %dx%d does not match canvas %dx%d",
+				i, fb.Dx(), fb.Dy(), width, height)
+		}
+
+		opt := applyDefaults(a.optionsForFrame(i))
+		var rgba *image.RGBA
+		if opt.HighPrecisionInput {
+			if out := adjustImageHighPrecision(frame); out != nil {
+				rgba = toRGBAImage(out)
+			}
+		}
+		if rgba == nil {
+			rgba = toRGBAImage(adjustImage(frame))
+		}
+
+		var pic C.WebPPicture
+		if C.WebPPictureInit(&pic) == 0 {
+			return errors.New("webp: EncodeAll, WebPPictureInit failed")
+		}
+		pic.width = C.int(width)
+		pic.height = C.int(height)
+		pic.use_argb = 1
+
+		if C.WebPPictureImportRGBA(
+			&pic,
+			(*C.uint8_t)(unsafe.Pointer(&rgba.Pix[0])),
+			C.int(rgba.Stride),
+		) == 0 {
+			C.WebPPictureFree(&pic)
+			return errors.New("webp: EncodeAll, WebPPictureImportRGBA failed")
+		}
+
+		var config C.WebPConfig
+		if C.WebPConfigInit(&config) == 0 {
+			C.WebPPictureFree(&pic)
+			return errors.New("webp: EncodeAll, WebPConfigInit failed")
+		}
+		config.lossless = boolToCInt(opt.Lossless)
+		config.quality = C.float(opt.Quality)
+		config.method = C.int(opt.Method)
+
+		addStatus := C.WebPAnimEncoderAdd(enc, &pic, timestampMs, &config)
+		// WebPAnimEncoderAdd copies pic's imported pixels internally, so
+		// each frame's picture can be freed as soon as this call returns
+		// instead of piling up until EncodeAll returns.
+		C.WebPPictureFree(&pic)
+		if addStatus == 0 {
+			return errors.New("webp: EncodeAll, WebPAnimEncoderAdd failed")
+		}
+		timestampMs += C.int(a.Delays[i].Milliseconds())
+	}
+
+	// A final, frame-less WebPAnimEncoderAdd call marks the end of the
+	// animation at the last timestamp.
+	if C.WebPAnimEncoderAdd(enc, nil, timestampMs, nil) == 0 {
+		return errors.New("webp: EncodeAll, WebPAnimEncoderAdd (finalize) failed")
+	}
+
+	var webpData C.WebPData
+	defer C.WebPDataClear(&webpData)
+	if C.WebPAnimEncoderAssemble(enc, &webpData) == 0 {
+		return errors.New("webp: EncodeAll, WebPAnimEncoderAssemble failed")
+	}
+
+	output := C.GoBytes(unsafe.Pointer(webpData.bytes), C.int(webpData.size))
+	if len(a.ICCP) > 0 || len(a.EXIF) > 0 || len(a.XMP) > 0 {
+		var err error
+		output, err = muxSetMetadata(output, a.ICCP, a.EXIF, a.XMP)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := w.Write(output)
+	return err
+}
+
+func boolToCInt(b bool) C.int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// readAnimBackgroundColor reads back the canvas background color of an
+// assembled animated WebP via libwebp's demux API. It exists mainly so
+// tests can confirm EncodeAll packed Animation.BackgroundColor into
+// WebPMuxAnimParams.bgcolor correctly.
+func readAnimBackgroundColor(data []byte) (color.RGBA, error) {
+	webpData := C.WebPData{
+		bytes: (*C.uint8_t)(unsafe.Pointer(&data[0])),
+		size:  C.size_t(len(data)),
+	}
+	demux := C.WebPDemux(&webpData)
+	if demux == nil {
+		return color.RGBA{}, errors.New("webp: readAnimBackgroundColor, WebPDemux failed")
+	}
+	defer C.WebPDemuxDelete(demux)
+
+	bg := uint32(C.WebPDemuxGetI(demux, C.WEBP_FF_BACKGROUND_COLOR))
+	return color.RGBA{
+		A: uint8(bg),
+		R: uint8(bg >> 8),
+		G: uint8(bg >> 16),
+		B: uint8(bg >> 24),
+	}, nil
+}
+
+// muxSetMetadata attaches ICCP/EXIF/XMP chunks to an already-assembled
+// WebP container using libwebp's mux API.
+func muxSetMetadata(webp, iccp, exif, xmp []byte) ([]byte, error) {
+	webpData := C.WebPData{
+		bytes: (*C.uint8_t)(unsafe.Pointer(&webp[0])),
+		size:  C.size_t(len(webp)),
+	}
+	mux := C.WebPMuxCreate(&webpData, 1)
+	if mux == nil {
+		return nil, errors.New("webp: muxSetMetadata, WebPMuxCreate failed")
+	}
+	defer C.WebPMuxDelete(mux)
+
+	if err := muxSetChunk(mux, "ICCP", iccp); err != nil {
+		return nil, err
+	}
+	if err := muxSetChunk(mux, "EXIF", exif); err != nil {
+		return nil, err
+	}
+	if err := muxSetChunk(mux, "XMP ", xmp); err != nil {
+		return nil, err
+	}
+
+	var out C.WebPData
+	defer C.WebPDataClear(&out)
+	if C.WebPMuxAssemble(mux, &out) != C.WEBP_MUX_OK {
+		return nil, errors.New("webp: muxSetMetadata, WebPMuxAssemble failed")
+	}
+	return C.GoBytes(unsafe.Pointer(out.bytes), C.int(out.size)), nil
+}
+
+func muxSetChunk(mux *C.WebPMux, fourcc string, data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+	cFourCC := C.CString(fourcc)
+	defer C.free(unsafe.Pointer(cFourCC))
+
+	chunk := C.WebPData{
+		bytes: (*C.uint8_t)(unsafe.Pointer(&data[0])),
+		size:  C.size_t(len(data)),
+	}
+	if C.WebPMuxSetChunk(mux, cFourCC, &chunk, 1) != C.WEBP_MUX_OK {
+		return fmt.Errorf("webp: muxSetChunk, WebPMuxSetChunk(%s) failed", fourcc)
+	}
+	return nil
+}
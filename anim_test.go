@@ -0,0 +1,70 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package webp
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+	"time"
+)
+
+// TestEncodeAllValidation checks that EncodeAll returns an error for
+// malformed Animation values.
+func TestEncodeAllValidation(t *testing.T) {
+	frame := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	other := image.NewRGBA(image.Rect(0, 0, 8, 8))
+
+	tests := []struct {
+		name string
+		anim *Animation
+	}{
+		{"no frames", &Animation{}},
+		{"delays mismatch", &Animation{
+			Frames: []image.Image{frame},
+			Delays: nil,
+		}},
+		{"frame size mismatch", &Animation{
+			Frames: []image.Image{frame, other},
+			Delays: []time.Duration{100 * time.Millisecond, 100 * time.Millisecond},
+		}},
+	}
+
+	for _, tt := range tests {
+		buf := new(bytes.Buffer)
+		if err := EncodeAll(buf, tt.anim); err == nil {
+			t.Fatalf("%s: want error, got nil", tt.name)
+		}
+	}
+}
+
+// TestEncodeAllBackgroundColor confirms that Animation.BackgroundColor is
+// packed into WebPMuxAnimParams.bgcolor in the order libwebp expects
+// (A, R, G, B from the low byte up), by reading it back through the demux
+// API. A non-grey color catches a transposed channel.
+func TestEncodeAllBackgroundColor(t *testing.T) {
+	frame := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	want := color.RGBA{R: 0x11, G: 0x22, B: 0x33, A: 0x44}
+
+	anim := &Animation{
+		Frames:          []image.Image{frame, frame},
+		Delays:          []time.Duration{100 * time.Millisecond, 100 * time.Millisecond},
+		BackgroundColor: want,
+	}
+
+	buf := new(bytes.Buffer)
+	if err := EncodeAll(buf, anim); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := readAnimBackgroundColor(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Fatalf("background color = %+v, want %+v", got, want)
+	}
+}
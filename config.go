@@ -0,0 +1,262 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build cgo
+// +build cgo
+
+package webp
+
+import (
+	"image"
+	"io"
+)
+
+// Options has a known limitation: applyDefaults cannot tell an explicit
+// zero value (e.g. SnsStrength: 0, NearLossless: 0, UseSharpYuv: false)
+// apart from a field the caller never touched, so it silently overwrites
+// both with the libwebp default. Config, built through With* functional
+// options, fixes this by tracking which fields were actually mentioned and
+// only defaulting the rest.
+
+// configField identifies one optional Options field Config can track as
+// explicitly set.
+type configField uint32
+
+const (
+	fieldLossless configField = 1 << iota
+	fieldQuality
+	fieldMethod
+	fieldImageHint
+	fieldTargetSize
+	fieldTargetPsnr
+	fieldSegments
+	fieldSnsStrength
+	fieldFilterStrength
+	fieldFilterSharpness
+	fieldFilterType
+	fieldAutofilter
+	fieldAlphaCompression
+	fieldAlphaFiltering
+	fieldPass
+	fieldShowCompressed
+	fieldPreprocessing
+	fieldPartitions
+	fieldPartitionLimit
+	fieldEmulateJpegSize
+	fieldThreadLevel
+	fieldLowMemory
+	fieldNearLossless
+	fieldExact
+	fieldUseDeltaPalette
+	fieldUseSharpYuv
+	fieldHighPrecisionInput
+)
+
+// Config builds an Options value through functional options, so that only
+// the fields a caller actually mentions are set: everything else keeps the
+// libwebp default, whether the mentioned value is zero or not.
+type Config struct {
+	opt Options
+	set configField
+}
+
+// ConfigOption sets one field on a Config. Use the With* functions below
+// to construct one.
+type ConfigOption func(*Config)
+
+// NewConfig builds a Config from the given options.
+func NewConfig(opts ...ConfigOption) *Config {
+	c := &Config{}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+func WithLossless(v bool) ConfigOption {
+	return func(c *Config) { c.opt.Lossless = v; c.set |= fieldLossless }
+}
+func WithQuality(v float32) ConfigOption {
+	return func(c *Config) { c.opt.Quality = v; c.set |= fieldQuality }
+}
+func WithMethod(v int) ConfigOption {
+	return func(c *Config) { c.opt.Method = v; c.set |= fieldMethod }
+}
+func WithImageHint(v int) ConfigOption {
+	return func(c *Config) { c.opt.ImageHint = v; c.set |= fieldImageHint }
+}
+func WithTargetSize(v int) ConfigOption {
+	return func(c *Config) { c.opt.TargetSize = v; c.set |= fieldTargetSize }
+}
+func WithTargetPsnr(v float32) ConfigOption {
+	return func(c *Config) { c.opt.TargetPsnr = v; c.set |= fieldTargetPsnr }
+}
+func WithSegments(v int) ConfigOption {
+	return func(c *Config) { c.opt.Segments = v; c.set |= fieldSegments }
+}
+func WithSnsStrength(v int) ConfigOption {
+	return func(c *Config) { c.opt.SnsStrength = v; c.set |= fieldSnsStrength }
+}
+func WithFilterStrength(v int) ConfigOption {
+	return func(c *Config) { c.opt.FilterStrength = v; c.set |= fieldFilterStrength }
+}
+func WithFilterSharpness(v int) ConfigOption {
+	return func(c *Config) { c.opt.FilterSharpness = v; c.set |= fieldFilterSharpness }
+}
+func WithFilterType(v int) ConfigOption {
+	return func(c *Config) { c.opt.FilterType = v; c.set |= fieldFilterType }
+}
+func WithAutofilter(v bool) ConfigOption {
+	return func(c *Config) { c.opt.Autofilter = v; c.set |= fieldAutofilter }
+}
+func WithAlphaCompression(v int) ConfigOption {
+	return func(c *Config) { c.opt.AlphaCompression = v; c.set |= fieldAlphaCompression }
+}
+func WithAlphaFiltering(v int) ConfigOption {
+	return func(c *Config) { c.opt.AlphaFiltering = v; c.set |= fieldAlphaFiltering }
+}
+func WithPass(v int) ConfigOption {
+	return func(c *Config) { c.opt.Pass = v; c.set |= fieldPass }
+}
+func WithShowCompressed(v bool) ConfigOption {
+	return func(c *Config) { c.opt.ShowCompressed = v; c.set |= fieldShowCompressed }
+}
+func WithPreprocessing(v int) ConfigOption {
+	return func(c *Config) { c.opt.Preprocessing = v; c.set |= fieldPreprocessing }
+}
+func WithPartitions(v int) ConfigOption {
+	return func(c *Config) { c.opt.Partitions = v; c.set |= fieldPartitions }
+}
+func WithPartitionLimit(v int) ConfigOption {
+	return func(c *Config) { c.opt.PartitionLimit = v; c.set |= fieldPartitionLimit }
+}
+func WithEmulateJpegSize(v bool) ConfigOption {
+	return func(c *Config) { c.opt.EmulateJpegSize = v; c.set |= fieldEmulateJpegSize }
+}
+func WithThreadLevel(v bool) ConfigOption {
+	return func(c *Config) { c.opt.ThreadLevel = v; c.set |= fieldThreadLevel }
+}
+func WithLowMemory(v bool) ConfigOption {
+	return func(c *Config) { c.opt.LowMemory = v; c.set |= fieldLowMemory }
+}
+
+// WithNearLossless sets NearLossless, including the explicit value 0
+// (maximum loss), without it being overwritten by the default of 100.
+func WithNearLossless(v int) ConfigOption {
+	return func(c *Config) { c.opt.NearLossless = v; c.set |= fieldNearLossless }
+}
+func WithExact(v int) ConfigOption {
+	return func(c *Config) { c.opt.Exact = v; c.set |= fieldExact }
+}
+func WithUseDeltaPalette(v bool) ConfigOption {
+	return func(c *Config) { c.opt.UseDeltaPalette = v; c.set |= fieldUseDeltaPalette }
+}
+
+// WithSharpYUV sets UseSharpYuv, including the explicit value false,
+// without it being overwritten by the default of true.
+func WithSharpYUV(v bool) ConfigOption {
+	return func(c *Config) { c.opt.UseSharpYuv = v; c.set |= fieldUseSharpYuv }
+}
+
+// WithHighPrecisionInput sets HighPrecisionInput, opting RGBA64/NRGBA64/
+// Gray16 inputs into the dithered 16-bit-aware conversion path instead of
+// plain 8-bit truncation.
+func WithHighPrecisionInput(v bool) ConfigOption {
+	return func(c *Config) { c.opt.HighPrecisionInput = v; c.set |= fieldHighPrecisionInput }
+}
+
+// resolve returns the Options that Config describes, applying the libwebp
+// default for every field the caller never mentioned and leaving every
+// mentioned field, including an explicit zero value, untouched.
+func (c *Config) resolve() *Options {
+	opt := c.opt
+	if c.set&fieldQuality == 0 {
+		opt.Quality = DefaulQuality
+	}
+	if c.set&fieldMethod == 0 {
+		opt.Method = 4
+	}
+	if c.set&fieldSegments == 0 {
+		opt.Segments = 2
+	}
+	if c.set&fieldSnsStrength == 0 {
+		opt.SnsStrength = 100
+	}
+	if c.set&fieldFilterStrength == 0 {
+		opt.FilterStrength = 100
+	}
+	if c.set&fieldFilterType == 0 {
+		opt.FilterType = 1
+	}
+	if c.set&fieldAlphaCompression == 0 {
+		opt.AlphaCompression = 1
+	}
+	if c.set&fieldAlphaFiltering == 0 {
+		opt.AlphaFiltering = 1
+	}
+	if c.set&fieldPass == 0 {
+		opt.Pass = 1
+	}
+	if c.set&fieldPreprocessing == 0 {
+		opt.Preprocessing = 1
+	}
+	if c.set&fieldNearLossless == 0 {
+		opt.NearLossless = 100
+	}
+	if c.set&fieldUseSharpYuv == 0 {
+		opt.UseSharpYuv = true
+	}
+	return &opt
+}
+
+// EncodeWithConfig writes the image m to w in WEBP format using cfg. Unlike
+// Encode, which takes the legacy *Options and inherits its "zero means
+// unset" limitation, EncodeWithConfig only applies libwebp defaults to
+// fields cfg never mentioned, so e.g. WithNearLossless(0) and
+// WithSharpYUV(false) take effect exactly as given.
+func EncodeWithConfig(w io.Writer, m image.Image, cfg *Config) error {
+	if cfg == nil {
+		cfg = NewConfig()
+	}
+	opt := cfg.resolve()
+	buf := &EncoderBuffer{}
+
+	switch m := adjustImageInto(m, opt, buf).(type) {
+	case *image.RGBA:
+		output, err := EncodeRGBAWithConfig(m, opt)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(output)
+		return err
+	case *image.Gray:
+		var output []byte
+		var err error
+		if opt.Lossless {
+			output, err = EncodeLosslessGray(m)
+		} else {
+			output, err = EncodeGray(m, opt.Quality)
+		}
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(output)
+		return err
+	case *RGBImage:
+		var output []byte
+		var err error
+		if opt.Lossless {
+			output, err = EncodeLosslessRGB(m)
+		} else {
+			output, err = EncodeRGB(m, opt.Quality)
+		}
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(output)
+		return err
+	default:
+		panic("image/webp: EncodeWithConfig, unreachable!")
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package webp
+
+import (
+	"bytes"
+	"testing"
+)
+
+// TestConfigExplicitZero confirms that Config, unlike Options, lets a
+// caller pin NearLossless and SnsStrength to 0 and UseSharpYuv to false,
+// and still have those exact values reach the resolved Options.
+func TestConfigExplicitZero(t *testing.T) {
+	cfg := NewConfig(
+		WithNearLossless(0),
+		WithSnsStrength(0),
+		WithSharpYUV(false),
+	)
+	opt := cfg.resolve()
+
+	if opt.NearLossless != 0 {
+		t.Fatalf("NearLossless = %d, want 0", opt.NearLossless)
+	}
+	if opt.SnsStrength != 0 {
+		t.Fatalf("SnsStrength = %d, want 0", opt.SnsStrength)
+	}
+	if opt.UseSharpYuv {
+		t.Fatalf("UseSharpYuv = true, want false")
+	}
+}
+
+// TestConfigDefaults confirms that fields left unmentioned still pick up
+// the libwebp defaults, the same values applyDefaults would have produced.
+func TestConfigDefaults(t *testing.T) {
+	opt := NewConfig().resolve()
+
+	if opt.Quality != DefaulQuality {
+		t.Fatalf("Quality = %v, want %v", opt.Quality, DefaulQuality)
+	}
+	if opt.NearLossless != 100 {
+		t.Fatalf("NearLossless = %d, want 100", opt.NearLossless)
+	}
+	if !opt.UseSharpYuv {
+		t.Fatalf("UseSharpYuv = false, want true")
+	}
+}
+
+// TestEncodeWithConfigNearLosslessZero confirms that WithNearLossless(0)
+// reaches libwebp unchanged by observing its effect on the actual encode:
+// NearLossless 0 trades exactness for size on a lossless encode, so it must
+// decode back with a nonzero delta, unlike the default of 100 (off).
+func TestEncodeWithConfigNearLosslessZero(t *testing.T) {
+	img0, err := loadImage("2_webp_ll.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bufDefault := new(bytes.Buffer)
+	if err := EncodeWithConfig(bufDefault, img0, NewConfig(WithLossless(true))); err != nil {
+		t.Fatal(err)
+	}
+	imgDefault, err := Decode(bufDefault)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := averageDelta(img0, imgDefault); got != 0 {
+		t.Fatalf("default NearLossless: average delta = %d, want 0", got)
+	}
+
+	bufZero := new(bytes.Buffer)
+	if err := EncodeWithConfig(bufZero, img0, NewConfig(WithLossless(true), WithNearLossless(0))); err != nil {
+		t.Fatal(err)
+	}
+	imgZero, err := Decode(bufZero)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := averageDelta(img0, imgZero); got == 0 {
+		t.Fatalf("NearLossless(0): average delta = 0, want > 0; explicit zero was not forwarded to libwebp")
+	}
+}
+
+// TestEncodeWithConfigSharpYUVFalse confirms that WithSharpYUV(false)
+// reaches EncodeRGBAWithConfig, and through it libwebp, by checking that it
+// produces different output bytes than the default (sharp YUV on).
+func TestEncodeWithConfigSharpYUVFalse(t *testing.T) {
+	img0, err := loadImage("video-001.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bufDefault := new(bytes.Buffer)
+	if err := EncodeWithConfig(bufDefault, img0, NewConfig(WithQuality(90))); err != nil {
+		t.Fatal(err)
+	}
+
+	bufFalse := new(bytes.Buffer)
+	if err := EncodeWithConfig(bufFalse, img0, NewConfig(WithQuality(90), WithSharpYUV(false))); err != nil {
+		t.Fatal(err)
+	}
+
+	if bytes.Equal(bufDefault.Bytes(), bufFalse.Bytes()) {
+		t.Fatalf("WithSharpYUV(false) produced identical output to the default; explicit false was not forwarded to libwebp")
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build cgo
+// +build cgo
+
+package webp
+
+/*
+#include "webp/decode.h"
+*/
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"unsafe"
+)
+
+// Decode reads a WEBP image from r and returns it as an image.Image.
+// A lossy bitstream with an alpha channel (VP8 + ALPH chunks) is returned
+// as an *NYCbCrA, keeping the native Y'CbCr planes; everything else is
+// returned as an *image.RGBA.
+func Decode(r io.Reader) (image.Image, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if hasAlphaChunk(data) {
+		return decodeNYCbCrA(data)
+	}
+	return decodeRGBA(data)
+}
+
+// DecodeConfig returns the color model and dimensions of a WEBP image
+// without decoding the whole thing.
+func DecodeConfig(r io.Reader) (image.Config, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return image.Config{}, err
+	}
+	if len(data) == 0 {
+		return image.Config{}, errors.New("webp: DecodeConfig, empty data")
+	}
+
+	var features C.WebPBitstreamFeatures
+	status := C.WebPGetFeatures(
+		(*C.uint8_t)(unsafe.Pointer(&data[0])),
+		C.size_t(len(data)),
+		&features,
+	)
+	if status != C.VP8_STATUS_OK {
+		return image.Config{}, fmt.Errorf("webp: DecodeConfig, WebPGetFeatures failed with status %d", status)
+	}
+
+	cm := color.Model(color.RGBAModel)
+	if features.has_alpha != 0 && features.format == 1 {
+		cm = NYCbCrAModel
+	}
+	return image.Config{
+		ColorModel: cm,
+		Width:      int(features.width),
+		Height:     int(features.height),
+	}, nil
+}
+
+// decodeRGBA decodes any WEBP bitstream into an *image.RGBA.
+func decodeRGBA(data []byte) (*image.RGBA, error) {
+	if len(data) == 0 {
+		return nil, errors.New("webp: decodeRGBA, empty data")
+	}
+
+	var width, height C.int
+	ptr := C.WebPDecodeRGBA(
+		(*C.uint8_t)(unsafe.Pointer(&data[0])),
+		C.size_t(len(data)),
+		&width, &height,
+	)
+	if ptr == nil {
+		return nil, errors.New("webp: decodeRGBA, WebPDecodeRGBA failed")
+	}
+	defer C.WebPFree(unsafe.Pointer(ptr))
+
+	w, h := int(width), int(height)
+	return &image.RGBA{
+		Pix:    C.GoBytes(unsafe.Pointer(ptr), C.int(w*h*4)),
+		Stride: w * 4,
+		Rect:   image.Rect(0, 0, w, h),
+	}, nil
+}
@@ -0,0 +1,95 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build cgo
+// +build cgo
+
+package webp
+
+/*
+#include <string.h>
+#include "webp/decode.h"
+*/
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"unsafe"
+)
+
+// decodeNYCbCrA decodes a lossy WebP bitstream (VP8 + ALPH chunks) directly
+// into an *NYCbCrA, keeping the Y'CbCr planes libwebp already produces
+// instead of converting them to RGBA first. Decode calls this instead of
+// the RGBA path whenever the bitstream has an alpha channel but is not
+// lossless (WebP lossless bitstreams have no separate Y'CbCr
+// representation to preserve); DecodeConfig reports NYCbCrAModel for the
+// same bitstreams.
+func decodeNYCbCrA(data []byte) (*NYCbCrA, error) {
+	if len(data) == 0 {
+		return nil, errors.New("webp: decodeNYCbCrA, empty data")
+	}
+
+	var config C.WebPDecoderConfig
+	if C.WebPInitDecoderConfig(&config) == 0 {
+		return nil, errors.New("webp: decodeNYCbCrA, WebPInitDecoderConfig failed")
+	}
+	config.output.colorspace = C.MODE_YUVA
+
+	status := C.WebPDecode(
+		(*C.uint8_t)(unsafe.Pointer(&data[0])),
+		C.size_t(len(data)),
+		&config,
+	)
+	if status != C.VP8_STATUS_OK {
+		return nil, fmt.Errorf("webp: decodeNYCbCrA, WebPDecode failed with status %d", status)
+	}
+	defer C.WebPFreeDecBuffer(&config.output)
+
+	yuva := (*C.WebPYUVABuffer)(unsafe.Pointer(&config.output.u[0]))
+	width := int(config.output.width)
+	height := int(config.output.height)
+
+	m := &NYCbCrA{
+		YCbCr: image.YCbCr{
+			Rect:           image.Rect(0, 0, width, height),
+			SubsampleRatio: image.YCbCrSubsampleRatio420,
+			YStride:        int(yuva.y_stride),
+			CStride:        int(yuva.u_stride),
+			Y:              goBytesFromCBuffer(yuva.y, int(yuva.y_stride)*height),
+			Cb:             goBytesFromCBuffer(yuva.u, int(yuva.u_stride)*((height+1)/2)),
+			Cr:             goBytesFromCBuffer(yuva.v, int(yuva.v_stride)*((height+1)/2)),
+		},
+		A:       goBytesFromCBuffer(yuva.a, int(yuva.a_stride)*height),
+		AStride: int(yuva.a_stride),
+	}
+	return m, nil
+}
+
+// goBytesFromCBuffer copies a libwebp-owned plane into Go-managed memory so
+// it stays valid after WebPFreeDecBuffer runs.
+func goBytesFromCBuffer(p *C.uint8_t, n int) []uint8 {
+	if p == nil || n <= 0 {
+		return nil
+	}
+	return C.GoBytes(unsafe.Pointer(p), C.int(n))
+}
+
+// hasAlphaChunk reports whether a WebP bitstream is lossy and has an alpha
+// channel (an ALPH chunk), i.e. whether decoding it as lossy-with-alpha via
+// decodeNYCbCrA is possible. Decode calls this to decide between the RGBA
+// path and the NYCbCrA path; DecodeConfig makes the same check inline.
+func hasAlphaChunk(data []byte) bool {
+	var features C.WebPBitstreamFeatures
+	if len(data) == 0 {
+		return false
+	}
+	status := C.WebPGetFeatures(
+		(*C.uint8_t)(unsafe.Pointer(&data[0])),
+		C.size_t(len(data)),
+		&features,
+	)
+	return status == C.VP8_STATUS_OK && features.has_alpha != 0 && features.format == 1
+}
@@ -0,0 +1,43 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package webp
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+)
+
+// TestDecodeLossyAlphaReturnsNYCbCrA confirms that decoding a lossy WebP
+// with a varying alpha channel returns the concrete *NYCbCrA type instead
+// of converting through RGBA.
+func TestDecodeLossyAlphaReturnsNYCbCrA(t *testing.T) {
+	b := image.Rect(0, 0, 16, 16)
+	img := image.NewRGBA(b)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			img.SetRGBA(x, y, color.RGBA{
+				R: uint8(x * 16),
+				G: uint8(y * 16),
+				B: 128,
+				A: uint8((x + y) * 8),
+			})
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	if err := Encode(buf, img, &Options{Quality: 80}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := Decode(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := got.(*NYCbCrA); !ok {
+		t.Fatalf("Decode returned %T, want *NYCbCrA", got)
+	}
+}
@@ -0,0 +1,270 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build cgo
+// +build cgo
+
+package webp
+
+import (
+	"image"
+	"image/color"
+	"io"
+	"reflect"
+)
+
+// EncoderBuffer holds the scratch space an Encoder reuses between calls to
+// Encode: the intermediate RGBA/Gray/RGB conversion targets produced by
+// adjustImageInto. The final encoded bytes returned by the libwebp-backed
+// Encode* functions (EncodeRGBAWithConfig and friends) are always freshly
+// allocated by those functions; reusing that allocation would require
+// changing their signatures, so EncoderBuffer only covers the conversion
+// step, which is the part under this package's control.
+type EncoderBuffer struct {
+	rgba *image.RGBA
+	gray *image.Gray
+	rgb  *RGBImage
+}
+
+// EncoderBufferPool is an interface for getting and returning temporary
+// instances of the EncoderBuffer struct. This can be used to reuse buffers
+// when encoding multiple images.
+type EncoderBufferPool interface {
+	Get() *EncoderBuffer
+	Put(*EncoderBuffer)
+}
+
+// Encoder mirrors image/png's Encoder: it holds encoding configuration and,
+// optionally, a BufferPool that lets callers reuse the scratch buffers
+// allocated while encoding across many Encode calls.
+type Encoder struct {
+	Options *Options
+
+	// BufferPool, if not nil, is used to manage the memory used to encode
+	// images and save some allocations.
+	BufferPool EncoderBufferPool
+}
+
+// Encode writes the image m to w in WEBP format.
+func (enc *Encoder) Encode(w io.Writer, m image.Image) error {
+	var buf *EncoderBuffer
+	if enc.BufferPool != nil {
+		buf = enc.BufferPool.Get()
+		defer enc.BufferPool.Put(buf)
+	}
+	if buf == nil {
+		buf = &EncoderBuffer{}
+	}
+	return encodeBuffer(w, m, enc.Options, buf)
+}
+
+type imageKind int
+
+const (
+	kindGray imageKind = iota
+	kindRGB
+	kindRGBA
+)
+
+// classifyImage determines which of Gray/RGB/RGBA adjustImage would
+// convert m to, without performing the conversion itself, so
+// adjustImageInto can pick the right pooled buffer before doing a single
+// conversion pass.
+func classifyImage(m image.Image) imageKind {
+	if p, ok := AsMemPImage(m); ok {
+		switch p.XChannels {
+		case 1:
+			return kindGray
+		case 3:
+			return kindRGB
+		case 4:
+			return kindRGBA
+		}
+	}
+	switch m.(type) {
+	case *image.Gray16:
+		return kindGray
+	case *RGB48Image, *image.YCbCr:
+		return kindRGB
+	default:
+		return kindRGBA
+	}
+}
+
+// adjustImageInto is like adjustImage, but converts at most once: an
+// already-native image is returned unchanged (the same zero-copy fast
+// path adjustImage takes), and anything else is converted directly into
+// buf's pooled RGBA/Gray/RGB target, resizing it only when the image
+// bounds change.
+func adjustImageInto(m image.Image, opt *Options, buf *EncoderBuffer) image.Image {
+	if opt != nil && opt.HighPrecisionInput {
+		if out := adjustImageHighPrecision(m); out != nil {
+			return out
+		}
+	}
+
+	if p, ok := AsMemPImage(m); ok {
+		switch {
+		case p.XChannels == 1 && p.XDataType == reflect.Uint8:
+			return &image.Gray{Pix: p.XPix, Stride: p.XStride, Rect: p.XRect}
+		case p.XChannels == 3 && p.XDataType == reflect.Uint8:
+			return &RGBImage{XPix: p.XPix, XStride: p.XStride, XRect: p.XRect}
+		case p.XChannels == 4 && p.XDataType == reflect.Uint8:
+			return &image.RGBA{Pix: p.XPix, Stride: p.XStride, Rect: p.XRect}
+		}
+	}
+	switch m.(type) {
+	case *image.Gray, *RGBImage, *image.RGBA:
+		return m
+	}
+
+	switch classifyImage(m) {
+	case kindGray:
+		return convertGrayInto(m, buf)
+	case kindRGB:
+		return convertRGBInto(m, buf)
+	default:
+		return convertRGBAInto(m, buf)
+	}
+}
+
+func convertGrayInto(m image.Image, buf *EncoderBuffer) *image.Gray {
+	b := m.Bounds()
+	if buf.gray == nil || !buf.gray.Rect.Eq(b) {
+		buf.gray = image.NewGray(b)
+	}
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := color.GrayModel.Convert(m.At(x, y)).(color.Gray)
+			buf.gray.SetGray(x, y, c)
+		}
+	}
+	return buf.gray
+}
+
+func convertRGBAInto(m image.Image, buf *EncoderBuffer) *image.RGBA {
+	b := m.Bounds()
+	if buf.rgba == nil || !buf.rgba.Rect.Eq(b) {
+		buf.rgba = image.NewRGBA(b)
+	}
+	dstColorRGBA64 := &color.RGBA64{}
+	dstColor := color.Color(dstColorRGBA64)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			pr, pg, pb, pa := m.At(x, y).RGBA()
+			dstColorRGBA64.R = uint16(pr)
+			dstColorRGBA64.G = uint16(pg)
+			dstColorRGBA64.B = uint16(pb)
+			dstColorRGBA64.A = uint16(pa)
+			buf.rgba.Set(x, y, dstColor)
+		}
+	}
+	return buf.rgba
+}
+
+func convertRGBInto(m image.Image, buf *EncoderBuffer) *RGBImage {
+	b := m.Bounds()
+	w, h := b.Dx(), b.Dy()
+	stride := w * 3
+	if buf.rgb == nil || !buf.rgb.XRect.Eq(b) || buf.rgb.XStride != stride {
+		buf.rgb = &RGBImage{XPix: make([]uint8, stride*h), XStride: stride, XRect: b}
+	}
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r, g, bl, _ := m.At(x, y).RGBA()
+			off := (y-b.Min.Y)*stride + (x-b.Min.X)*3
+			buf.rgb.XPix[off+0] = uint8(r >> 8)
+			buf.rgb.XPix[off+1] = uint8(g >> 8)
+			buf.rgb.XPix[off+2] = uint8(bl >> 8)
+		}
+	}
+	return buf.rgb
+}
+
+// encodeBuffer performs Encode's format dispatch. It converts m through
+// adjustImageInto rather than adjustImage, so repeated calls with
+// same-sized images reuse buf's conversion targets instead of allocating
+// fresh ones.
+func encodeBuffer(w io.Writer, m image.Image, opt *Options, buf *EncoderBuffer) (err error) {
+	var output []byte
+
+	if opt != nil && hasAdvancedOptions(opt) {
+		opt = applyDefaults(opt)
+		switch m := adjustImageInto(m, opt, buf).(type) {
+		case *image.RGBA:
+			if output, err = EncodeRGBAWithConfig(m, opt); err != nil {
+				return
+			}
+		case *image.Gray:
+			if opt.Lossless {
+				if output, err = EncodeLosslessGray(m); err != nil {
+					return
+				}
+			} else {
+				if output, err = EncodeGray(m, opt.Quality); err != nil {
+					return
+				}
+			}
+		case *RGBImage:
+			if opt.Lossless {
+				if output, err = EncodeLosslessRGB(m); err != nil {
+					return
+				}
+			} else {
+				if output, err = EncodeRGB(m, opt.Quality); err != nil {
+					return
+				}
+			}
+		default:
+			panic("image/webp: Encode, unreachable!")
+		}
+	} else if opt != nil && opt.Lossless {
+		switch m := adjustImageInto(m, opt, buf).(type) {
+		case *image.Gray:
+			if output, err = EncodeLosslessGray(m); err != nil {
+				return
+			}
+		case *RGBImage:
+			if output, err = EncodeLosslessRGB(m); err != nil {
+				return
+			}
+		case *image.RGBA:
+			if opt.Exact != 0 {
+				output, err = EncodeExactLosslessRGBA(m)
+			} else {
+				output, err = EncodeLosslessRGBA(m)
+			}
+			if err != nil {
+				return
+			}
+		default:
+			panic("image/webp: Encode, unreachable!")
+		}
+	} else {
+		quality := float32(DefaulQuality)
+		if opt != nil {
+			quality = opt.Quality
+		}
+
+		switch m := adjustImageInto(m, opt, buf).(type) {
+		case *image.Gray:
+			if output, err = EncodeGray(m, quality); err != nil {
+				return
+			}
+		case *RGBImage:
+			if output, err = EncodeRGB(m, quality); err != nil {
+				return
+			}
+		case *image.RGBA:
+			if output, err = EncodeRGBA(m, quality); err != nil {
+				return
+			}
+		default:
+			panic("image/webp: Encode, unreachable!")
+		}
+	}
+
+	_, err = w.Write(output)
+	return
+}
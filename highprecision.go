@@ -0,0 +1,134 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package webp
+
+import (
+	"image"
+	"image/color"
+)
+
+// adjustImageHighPrecision converts m to an 8-bit image using Floyd-Steinberg
+// error-diffusion dithering instead of the plain truncation toRGBAImage and
+// toGrayImage use, preserving the extra precision of RGBA64/NRGBA64/Gray16
+// inputs instead of collapsing it at the front door. It returns nil for any
+// other image type, so callers can fall back to adjustImage.
+func adjustImageHighPrecision(m image.Image) image.Image {
+	switch m.(type) {
+	case *image.RGBA64, *image.NRGBA64:
+		return ditherRGBA(m)
+	case *image.Gray16:
+		return ditherGray(m)
+	default:
+		return nil
+	}
+}
+
+// ditherGray dithers a 16-bit grayscale image down to 8 bits per sample.
+//
+// The below-left/below/below-right terms (3/16, 5/16, 1/16) diffuse into the
+// row being read one iteration later, so they live in a separate next-row
+// buffer rather than the row currently being read from: overwriting the
+// buffer a row is still reading from, or resetting it before the next row
+// consumes it, silently drops most of the propagated error.
+func ditherGray(m image.Image) *image.Gray {
+	b := m.Bounds()
+	dst := image.NewGray(b)
+	w, h := b.Dx(), b.Dy()
+	prev := make([]float32, w+2)
+	next := make([]float32, w+2)
+
+	for y := 0; y < h; y++ {
+		var carry float32
+		for x := 0; x < w; x++ {
+			_, g, _, _ := m.At(b.Min.X+x, b.Min.Y+y).RGBA()
+			v8, diff := ditherSample(float32(g)/257 + carry + prev[x+1])
+
+			next[x] += diff * 3 / 16
+			next[x+1] += diff * 5 / 16
+			next[x+2] += diff * 1 / 16
+			carry = diff * 7 / 16
+
+			dst.SetGray(b.Min.X+x, b.Min.Y+y, color.Gray{Y: v8})
+		}
+		prev, next = next, prev
+		for i := range next {
+			next[i] = 0
+		}
+	}
+	return dst
+}
+
+// ditherRGBA dithers a 16-bit-per-channel RGBA/NRGBA image down to 8 bits
+// per channel, one channel at a time. See ditherGray for why the vertical
+// error terms need their own next-row buffer.
+func ditherRGBA(m image.Image) *image.RGBA {
+	b := m.Bounds()
+	dst := image.NewRGBA(b)
+	w, h := b.Dx(), b.Dy()
+
+	prevR := make([]float32, w+2)
+	prevG := make([]float32, w+2)
+	prevB := make([]float32, w+2)
+	prevA := make([]float32, w+2)
+	nextR := make([]float32, w+2)
+	nextG := make([]float32, w+2)
+	nextB := make([]float32, w+2)
+	nextA := make([]float32, w+2)
+
+	for y := 0; y < h; y++ {
+		var carryR, carryG, carryB, carryA float32
+		for x := 0; x < w; x++ {
+			r16, g16, b16, a16 := m.At(b.Min.X+x, b.Min.Y+y).RGBA()
+
+			r8, dr := ditherSample(float32(r16)/257 + carryR + prevR[x+1])
+			g8, dg := ditherSample(float32(g16)/257 + carryG + prevG[x+1])
+			b8, db := ditherSample(float32(b16)/257 + carryB + prevB[x+1])
+			a8, da := ditherSample(float32(a16)/257 + carryA + prevA[x+1])
+
+			nextR[x] += dr * 3 / 16
+			nextG[x] += dg * 3 / 16
+			nextB[x] += db * 3 / 16
+			nextA[x] += da * 3 / 16
+
+			nextR[x+1] += dr * 5 / 16
+			nextG[x+1] += dg * 5 / 16
+			nextB[x+1] += db * 5 / 16
+			nextA[x+1] += da * 5 / 16
+
+			nextR[x+2] += dr * 1 / 16
+			nextG[x+2] += dg * 1 / 16
+			nextB[x+2] += db * 1 / 16
+			nextA[x+2] += da * 1 / 16
+
+			carryR, carryG, carryB, carryA = dr*7/16, dg*7/16, db*7/16, da*7/16
+
+			dst.SetRGBA(b.Min.X+x, b.Min.Y+y, color.RGBA{R: r8, G: g8, B: b8, A: a8})
+		}
+		prevR, nextR = nextR, prevR
+		prevG, nextG = nextG, prevG
+		prevB, nextB = nextB, prevB
+		prevA, nextA = nextA, prevA
+		for i := range nextR {
+			nextR[i], nextG[i], nextB[i], nextA[i] = 0, 0, 0, 0
+		}
+	}
+	return dst
+}
+
+func ditherSample(v float32) (uint8, float32) {
+	v8 := clamp8(v)
+	return v8, v - float32(v8)
+}
+
+func clamp8(v float32) uint8 {
+	switch {
+	case v <= 0:
+		return 0
+	case v >= 255:
+		return 255
+	default:
+		return uint8(v + 0.5)
+	}
+}
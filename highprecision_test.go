@@ -0,0 +1,163 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package webp
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestAdjustImageHighPrecisionGray16(t *testing.T) {
+	src := image.NewGray16(image.Rect(0, 0, 4, 4))
+	for i := range src.Pix {
+		src.Pix[i] = 0xab
+	}
+
+	out := adjustImageHighPrecision(src)
+	gray, ok := out.(*image.Gray)
+	if !ok {
+		t.Fatalf("adjustImageHighPrecision returned %T, want *image.Gray", out)
+	}
+	if !gray.Rect.Eq(src.Rect) {
+		t.Fatalf("rect = %v, want %v", gray.Rect, src.Rect)
+	}
+}
+
+func TestAdjustImageHighPrecisionRGBA64(t *testing.T) {
+	src := image.NewRGBA64(image.Rect(0, 0, 4, 4))
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 4; x++ {
+			src.SetRGBA64(x, y, color.RGBA64{R: 0x8001, G: 0x4001, B: 0x2001, A: 0xffff})
+		}
+	}
+
+	out := adjustImageHighPrecision(src)
+	rgba, ok := out.(*image.RGBA)
+	if !ok {
+		t.Fatalf("adjustImageHighPrecision returned %T, want *image.RGBA", out)
+	}
+	if !rgba.Rect.Eq(src.Rect) {
+		t.Fatalf("rect = %v, want %v", rgba.Rect, src.Rect)
+	}
+}
+
+func TestAdjustImageHighPrecisionUnsupported(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	if out := adjustImageHighPrecision(src); out != nil {
+		t.Fatalf("want nil for an already-8-bit image, got %T", out)
+	}
+}
+
+// TestDitherGrayPreservesMean confirms that error-diffusion dithering
+// conserves the total quantization error, so the mean of the dithered
+// 8-bit output tracks the mean of the 16-bit source. A dropped diffusion
+// term (e.g. missing the 3/16 below-left weight) leaks error every pixel
+// and biases the mean away from the source.
+func TestDitherGrayPreservesMean(t *testing.T) {
+	const size = 32
+	// A value whose top 8 bits truncate to 0xab but that still carries a
+	// fractional remainder, so each pixel contributes real diffusion error.
+	const v16 = 0xab80
+
+	src := image.NewGray16(image.Rect(0, 0, size, size))
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			src.SetGray16(x, y, color.Gray16{Y: v16})
+		}
+	}
+
+	out := ditherGray(src)
+	var sum float64
+	for _, v := range out.Pix {
+		sum += float64(v)
+	}
+	gotMean := sum / float64(len(out.Pix))
+	wantMean := float64(v16) / 257
+
+	if diff := gotMean - wantMean; diff < -0.02 || diff > 0.02 {
+		t.Fatalf("mean = %v, want within 0.02 of %v", gotMean, wantMean)
+	}
+}
+
+// TestDitherRGBAPreservesMean is the RGBA analogue of
+// TestDitherGrayPreservesMean, checked on the red channel.
+func TestDitherRGBAPreservesMean(t *testing.T) {
+	const size = 32
+	const v16 = 0x8040
+
+	src := image.NewRGBA64(image.Rect(0, 0, size, size))
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			src.SetRGBA64(x, y, color.RGBA64{R: v16, G: v16, B: v16, A: 0xffff})
+		}
+	}
+
+	out := ditherRGBA(src)
+	var sum float64
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			sum += float64(out.RGBAAt(x, y).R)
+		}
+	}
+	gotMean := sum / float64(size*size)
+	wantMean := float64(v16) / 257
+
+	if diff := gotMean - wantMean; diff < -0.02 || diff > 0.02 {
+		t.Fatalf("mean = %v, want within 0.02 of %v", gotMean, wantMean)
+	}
+}
+
+// TestDitherGrayVerticalPropagation isolates the below/below-left/below-right
+// terms from the same-row carry by using a single-column (width 1) image, so
+// there is no horizontal neighbor for error to hide in. If vertical diffusion
+// is broken (e.g. the next-row buffer is cleared before the row below reads
+// it), every row rounds the same fractional remainder the same way and the
+// mean drifts from the source instead of tracking it.
+func TestDitherGrayVerticalPropagation(t *testing.T) {
+	const height = 64
+	const v16 = 0xab80
+
+	src := image.NewGray16(image.Rect(0, 0, 1, height))
+	for y := 0; y < height; y++ {
+		src.SetGray16(0, y, color.Gray16{Y: v16})
+	}
+
+	out := ditherGray(src)
+	var sum float64
+	for _, v := range out.Pix {
+		sum += float64(v)
+	}
+	gotMean := sum / float64(len(out.Pix))
+	wantMean := float64(v16 >> 8)
+
+	if diff := gotMean - wantMean; diff < -0.5 || diff > 0.5 {
+		t.Fatalf("mean = %v, want within 0.5 of %v (vertical diffusion not propagating)", gotMean, wantMean)
+	}
+}
+
+// TestDitherRGBAVerticalPropagation is the RGBA analogue of
+// TestDitherGrayVerticalPropagation.
+func TestDitherRGBAVerticalPropagation(t *testing.T) {
+	const height = 64
+	const v16 = 0x8040
+
+	src := image.NewRGBA64(image.Rect(0, 0, 1, height))
+	for y := 0; y < height; y++ {
+		src.SetRGBA64(0, y, color.RGBA64{R: v16, G: v16, B: v16, A: 0xffff})
+	}
+
+	out := ditherRGBA(src)
+	var sum float64
+	for y := 0; y < height; y++ {
+		sum += float64(out.RGBAAt(0, y).R)
+	}
+	gotMean := sum / float64(height)
+	wantMean := float64(v16 >> 8)
+
+	if diff := gotMean - wantMean; diff < -0.5 || diff > 0.5 {
+		t.Fatalf("mean = %v, want within 0.5 of %v (vertical diffusion not propagating)", gotMean, wantMean)
+	}
+}
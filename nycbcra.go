@@ -0,0 +1,145 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package webp
+
+import (
+	"image"
+	"image/color"
+)
+
+// NYCbCrAColor is a non-alpha-premultiplied Y'CbCr-with-alpha color,
+// analogous to color.YCbCr but carrying its own, separate alpha value.
+type NYCbCrAColor struct {
+	Y, Cb, Cr, A uint8
+}
+
+// RGBA implements the color.Color interface.
+func (c NYCbCrAColor) RGBA() (r, g, b, a uint32) {
+	r8, g8, b8 := color.YCbCrToRGB(c.Y, c.Cb, c.Cr)
+	a = uint32(c.A) * 0x101
+	r = uint32(r8) * 0x101 * uint32(c.A) / 0xff
+	g = uint32(g8) * 0x101 * uint32(c.A) / 0xff
+	b = uint32(b8) * 0x101 * uint32(c.A) / 0xff
+	return
+}
+
+// NYCbCrAModel is the color.Model for NYCbCrAColor.
+var NYCbCrAModel = color.ModelFunc(nycbcraModel)
+
+func nycbcraModel(c color.Color) color.Color {
+	if c, ok := c.(NYCbCrAColor); ok {
+		return c
+	}
+	r, g, b, a := c.RGBA()
+
+	// color.RGBToYCbCr expects non-premultiplied 8-bit samples, so
+	// demultiply by alpha first.
+	if a != 0 {
+		r = (r * 0xffff) / a
+		g = (g * 0xffff) / a
+		b = (b * 0xffff) / a
+	}
+
+	y, cb, cr := color.RGBToYCbCr(uint8(r>>8), uint8(g>>8), uint8(b>>8))
+	return NYCbCrAColor{Y: y, Cb: cb, Cr: cr, A: uint8(a >> 8)}
+}
+
+// NYCbCrA is an in-memory image of non-alpha-premultiplied Y'CbCr-with-alpha
+// colors: Y', Cb and Cr sample values are held in separate planes, plus a
+// fourth alpha plane. This mirrors the pixel layout that a lossy WebP image
+// with an alpha channel (VP8 + ALPH chunks) is natively stored in, so
+// decoding into an NYCbCrA avoids an unnecessary YUV->RGBA conversion.
+type NYCbCrA struct {
+	image.YCbCr
+	A       []uint8
+	AStride int
+}
+
+// ColorModel returns the NYCbCrA image's color model.
+func (p *NYCbCrA) ColorModel() color.Model {
+	return NYCbCrAModel
+}
+
+// AOffset returns the index of the first element of A that corresponds to
+// the pixel at (x, y).
+func (p *NYCbCrA) AOffset(x, y int) int {
+	return (y-p.Rect.Min.Y)*p.AStride + (x - p.Rect.Min.X)
+}
+
+// At implements the image.Image interface.
+func (p *NYCbCrA) At(x, y int) color.Color {
+	return p.NYCbCrAAt(x, y)
+}
+
+// NYCbCrAAt returns the NYCbCrAColor at (x, y).
+func (p *NYCbCrA) NYCbCrAAt(x, y int) NYCbCrAColor {
+	if !(image.Point{x, y}.In(p.Rect)) {
+		return NYCbCrAColor{}
+	}
+	yi := p.YOffset(x, y)
+	ci := p.COffset(x, y)
+	ai := p.AOffset(x, y)
+	return NYCbCrAColor{
+		Y:  p.Y[yi],
+		Cb: p.Cb[ci],
+		Cr: p.Cr[ci],
+		A:  p.A[ai],
+	}
+}
+
+// SubImage returns an image representing the portion of the image p
+// visible through r. The returned value shares pixels with the original
+// image.
+func (p *NYCbCrA) SubImage(r image.Rectangle) image.Image {
+	r = r.Intersect(p.Rect)
+	if r.Empty() {
+		return &NYCbCrA{
+			YCbCr:   image.YCbCr{SubsampleRatio: p.SubsampleRatio},
+			AStride: p.AStride,
+		}
+	}
+	yi := p.YOffset(r.Min.X, r.Min.Y)
+	ci := p.COffset(r.Min.X, r.Min.Y)
+	ai := p.AOffset(r.Min.X, r.Min.Y)
+	return &NYCbCrA{
+		YCbCr: image.YCbCr{
+			Y:              p.Y[yi:],
+			Cb:             p.Cb[ci:],
+			Cr:             p.Cr[ci:],
+			SubsampleRatio: p.SubsampleRatio,
+			YStride:        p.YStride,
+			CStride:        p.CStride,
+			Rect:           r,
+		},
+		A:       p.A[ai:],
+		AStride: p.AStride,
+	}
+}
+
+// NewNYCbCrA returns a new NYCbCrA image with the given bounds and
+// subsample ratio.
+func NewNYCbCrA(r image.Rectangle, subsampleRatio image.YCbCrSubsampleRatio) *NYCbCrA {
+	ycbcr := image.NewYCbCr(r, subsampleRatio)
+	w, h := r.Dx(), r.Dy()
+	return &NYCbCrA{
+		YCbCr:   *ycbcr,
+		A:       make([]uint8, w*h),
+		AStride: w,
+	}
+}
+
+// RGBA converts p to a *image.RGBA, compositing the alpha plane back in.
+// Use this when a caller needs a conventional alpha-premultiplied image,
+// e.g. to hand off to image/draw.
+func (p *NYCbCrA) RGBA() *image.RGBA {
+	b := p.Rect
+	rgba := image.NewRGBA(b)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			rgba.Set(x, y, p.NYCbCrAAt(x, y))
+		}
+	}
+	return rgba
+}
@@ -0,0 +1,51 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package webp
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestNYCbCrAModelConvert(t *testing.T) {
+	want := color.RGBA{R: 0x40, G: 0x80, B: 0xc0, A: 0xff}
+	got := NYCbCrAModel.Convert(want)
+	c, ok := got.(NYCbCrAColor)
+	if !ok {
+		t.Fatalf("Convert returned %T, want NYCbCrAColor", got)
+	}
+	if c.A != 0xff {
+		t.Fatalf("A = %d, want 255", c.A)
+	}
+}
+
+func TestNYCbCrARGBA(t *testing.T) {
+	r := image.Rect(0, 0, 4, 4)
+	m := NewNYCbCrA(r, image.YCbCrSubsampleRatio420)
+	for i := range m.Y {
+		m.Y[i] = 200
+	}
+	for i := range m.A {
+		m.A[i] = 128
+	}
+
+	rgba := m.RGBA()
+	if !rgba.Rect.Eq(r) {
+		t.Fatalf("rect = %v, want %v", rgba.Rect, r)
+	}
+	if _, _, _, a := rgba.At(1, 1).RGBA(); a == 0 {
+		t.Fatalf("expected non-zero alpha after RGBA conversion")
+	}
+}
+
+func TestNYCbCrASubImage(t *testing.T) {
+	r := image.Rect(0, 0, 8, 8)
+	m := NewNYCbCrA(r, image.YCbCrSubsampleRatio420)
+	sub := m.SubImage(image.Rect(2, 2, 6, 6)).(*NYCbCrA)
+	if sub.Bounds() != image.Rect(2, 2, 6, 6) {
+		t.Fatalf("bounds = %v, want (2,2)-(6,6)", sub.Bounds())
+	}
+}
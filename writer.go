@@ -86,6 +86,12 @@ type Options struct {
 	UseDeltaPalette bool
 	// If needed, use sharp (and slow) RGB->YUV conversion. Default: true
 	UseSharpYuv bool
+	// If true, preserve the extra precision of RGBA64/NRGBA64/Gray16
+	// inputs by dithering them down to 8 bits instead of truncating, so
+	// UseSharpYuv's chroma sub-sampling is computed from dithered rather
+	// than discarded low bits. Unlike the other advanced options, it also
+	// applies to Gray16 inputs. Default: false
+	HighPrecisionInput bool
 }
 
 type colorModeler interface {
@@ -95,7 +101,9 @@ type colorModeler interface {
 // applyDefaults fills in default values for unset fields in Options.
 // Note: Zero values (0, false) are treated as "unset" and will be replaced with defaults.
 // If you need to explicitly set a parameter to 0, this function will override it.
-// This is a known limitation of the current design.
+// This is a known limitation of the current design; use Config and the
+// With* functions instead of Options when a zero value must reach libwebp
+// unchanged.
 func applyDefaults(opt *Options) *Options {
 	if opt == nil {
 		opt = &Options{}
@@ -156,6 +164,9 @@ func hasAdvancedOptions(opt *Options) bool {
 		opt.NearLossless != 0 || opt.Exact != 0 || opt.UseDeltaPalette || opt.UseSharpYuv
 }
 
+// Save encodes the image m with the given options and writes it to the
+// named file. It is a thin wrapper over a default Encoder with no
+// BufferPool, so it allocates fresh scratch buffers on every call.
 func Save(name string, m image.Image, opt *Options) (err error) {
 	f, err := os.Create(name)
 	if err != nil {
@@ -163,99 +174,15 @@ func Save(name string, m image.Image, opt *Options) (err error) {
 	}
 	defer f.Close()
 
-	return encode(f, m, opt)
+	return (&Encoder{Options: opt}).Encode(f, m)
 }
 
-// Encode writes the image m to w in WEBP format.
+// Encode writes the image m to w in WEBP format. It is a thin wrapper over
+// a default Encoder with no BufferPool; servers that encode many images
+// should construct their own Encoder with a BufferPool to reuse scratch
+// buffers across calls.
 func Encode(w io.Writer, m image.Image, opt *Options) (err error) {
-	return encode(w, m, opt)
-}
-
-func encode(w io.Writer, m image.Image, opt *Options) (err error) {
-	var output []byte
-
-	// If advanced options are provided, use the detailed encoding function for RGBA
-	if opt != nil && hasAdvancedOptions(opt) {
-		opt = applyDefaults(opt)
-		switch m := adjustImage(m).(type) {
-		case *image.RGBA:
-			if output, err = EncodeRGBAWithConfig(m, opt); err != nil {
-				return
-			}
-		case *image.Gray:
-			// Fall back to simple encoding for Gray images.
-			// Advanced options are not supported for grayscale images.
-			if opt.Lossless {
-				if output, err = EncodeLosslessGray(m); err != nil {
-					return
-				}
-			} else {
-				if output, err = EncodeGray(m, opt.Quality); err != nil {
-					return
-				}
-			}
-		case *RGBImage:
-			// Fall back to simple encoding for RGB images.
-			// Advanced options are not supported for RGB images.
-			if opt.Lossless {
-				if output, err = EncodeLosslessRGB(m); err != nil {
-					return
-				}
-			} else {
-				if output, err = EncodeRGB(m, opt.Quality); err != nil {
-					return
-				}
-			}
-		default:
-			panic("image/webp: Encode, unreachable!")
-		}
-	} else if opt != nil && opt.Lossless {
-		switch m := adjustImage(m).(type) {
-		case *image.Gray:
-			if output, err = EncodeLosslessGray(m); err != nil {
-				return
-			}
-		case *RGBImage:
-			if output, err = EncodeLosslessRGB(m); err != nil {
-				return
-			}
-		case *image.RGBA:
-			if opt.Exact != 0 {
-				output, err = EncodeExactLosslessRGBA(m)
-			} else {
-				output, err = EncodeLosslessRGBA(m)
-			}
-			if err != nil {
-				return
-			}
-		default:
-			panic("image/webp: Encode, unreachable!")
-		}
-	} else {
-		quality := float32(DefaulQuality)
-		if opt != nil {
-			quality = opt.Quality
-		}
-
-		switch m := adjustImage(m).(type) {
-		case *image.Gray:
-			if output, err = EncodeGray(m, quality); err != nil {
-				return
-			}
-		case *RGBImage:
-			if output, err = EncodeRGB(m, quality); err != nil {
-				return
-			}
-		case *image.RGBA:
-			if output, err = EncodeRGBA(m, quality); err != nil {
-				return
-			}
-		default:
-			panic("image/webp: Encode, unreachable!")
-		}
-	}
-	_, err = w.Write(output)
-	return
+	return (&Encoder{Options: opt}).Encode(w, m)
 }
 
 func adjustImage(m image.Image) image.Image {
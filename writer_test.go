@@ -7,6 +7,7 @@ package webp
 import (
 	"bytes"
 	_ "image/png"
+	"io"
 	"testing"
 )
 
@@ -175,6 +176,89 @@ func TestEncode(t *testing.T) {
 	}
 }
 
+// poolTester is a trivial EncoderBufferPool that always hands out the same
+// buffer and counts how many times it was handed out.
+type poolTester struct {
+	buf *EncoderBuffer
+	got int
+}
+
+func (p *poolTester) Get() *EncoderBuffer {
+	if p.buf == nil {
+		p.buf = &EncoderBuffer{}
+	}
+	p.got++
+	return p.buf
+}
+
+func (p *poolTester) Put(buf *EncoderBuffer) {
+	p.buf = buf
+}
+
+// TestEncoderBufferPool confirms that an Encoder with a BufferPool takes
+// its *EncoderBuffer from the pool on every Encode call.
+func TestEncoderBufferPool(t *testing.T) {
+	img0, err := loadImage("video-001.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool := &poolTester{}
+	enc := &Encoder{
+		Options:    &Options{Quality: 90},
+		BufferPool: pool,
+	}
+
+	for i := 0; i < 3; i++ {
+		buf := new(bytes.Buffer)
+		if err := enc.Encode(buf, img0); err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		if _, err := Decode(buf); err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+	}
+	if pool.got != 3 {
+		t.Fatalf("want 3 Get calls, got %d", pool.got)
+	}
+}
+
+// TestEncoderBufferPoolReducesAllocs confirms that an Encoder with a
+// BufferPool actually saves allocations on repeated same-size encodes,
+// rather than just handing back the same *EncoderBuffer without reusing
+// the conversion targets inside it.
+func TestEncoderBufferPoolReducesAllocs(t *testing.T) {
+	img0, err := loadImage("video-001.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool := &poolTester{}
+	pooled := &Encoder{Options: &Options{Quality: 90}, BufferPool: pool}
+	unpooled := &Encoder{Options: &Options{Quality: 90}}
+
+	// Warm the pooled buffer up so it is already sized correctly before
+	// AllocsPerRun measures steady state.
+	if err := pooled.Encode(io.Discard, img0); err != nil {
+		t.Fatal(err)
+	}
+
+	pooledAllocs := testing.AllocsPerRun(5, func() {
+		if err := pooled.Encode(io.Discard, img0); err != nil {
+			t.Fatal(err)
+		}
+	})
+	unpooledAllocs := testing.AllocsPerRun(5, func() {
+		if err := unpooled.Encode(io.Discard, img0); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	if pooledAllocs >= unpooledAllocs {
+		t.Fatalf("pooled encoder allocated %v per run, want fewer than unpooled's %v", pooledAllocs, unpooledAllocs)
+	}
+}
+
 // TestEncodeAdvanced tests the new EncodeRGBAWithConfig functionality
 // with various advanced WebP encoding options.
 func TestEncodeAdvanced(t *testing.T) {